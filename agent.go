@@ -1,24 +1,30 @@
+// Command agent runs the tendrl agent: it accepts connections on a local
+// socket and forwards messages to the tendrl app, buffering them in a
+// durable, adaptively-batched queue. This file is wiring only — the
+// protocol, queue, host-metrics, and OS-specific setup live in
+// internal/transport, internal/queue, internal/sysinfo, and
+// internal/platform respectively.
 package main
 
 import (
-	"bufio"
-	"bytes"
-	"encoding/json"
+	"compress/gzip"
 	"flag"
 	"fmt"
-	"io"
-	"log"
-	"math"
 	"net"
 	"net/http"
 	"os"
 	"os/signal"
 	"runtime"
+	"sync/atomic"
 	"syscall"
 	"time"
 
-	"github.com/shirou/gopsutil/cpu"
-	"github.com/shirou/gopsutil/mem"
+	"gopkg.in/yaml.v3"
+
+	"tendrl/agent/internal/platform"
+	"tendrl/agent/internal/queue"
+	"tendrl/agent/internal/sysinfo"
+	"tendrl/agent/internal/transport"
 )
 
 type Config struct {
@@ -36,41 +42,40 @@ type Config struct {
 	TargetMemPercent float64
 	MinBatchInterval time.Duration
 	MaxBatchInterval time.Duration
+	MaxRetries       int
+	RetryBaseDelay   time.Duration
+	Compress         string
+	GzipLevel        int
+	Transport        string
+	PipeName         string
+	ListenAddr       string
+	TLSCert          string
+	TLSKey           string
+	TLSClientCA      string
+	ConfigFile       string
 }
 
-type MessageContext struct {
-	Tags         []string    `json:"tags,omitempty"`
-	Limit        interface{} `json:"-"`
-	WaitResponse bool        `json:"wait,omitempty"`
-	Entity       string      `json:"entity,omitempty"`
-}
+var config Config
 
-type Message struct {
-	Data        string         `json:"data,omitempty"` //omitempty to allow check_msg with no data
-	Context     MessageContext `json:"context,omitempty"`
-	MsgType     string         `json:"msg_type,omitempty"`
-	Destination string         `json:"dest,omitempty"`
-	Timestamp   string         `json:"timestamp,omitempty"`
-}
+// currentCfg holds the effective Config once InitializeConfig has resolved
+// flags and any --config file; it is swapped atomically on SIGHUP so
+// readers never observe a partially-applied reload.
+var currentCfg atomic.Pointer[Config]
 
-type ResponseMessage struct {
-	Status  string `json:"status"`
-	Message string `json:"message,omitempty"`
+// currentConfig returns the agent's current effective configuration.
+func currentConfig() Config {
+	return *currentCfg.Load()
 }
 
-type SystemMetrics struct {
-	CPUUsage    float64
-	MemoryUsage float64
-	QueueLoad   float64 // Current queue size / max queue size
+// positiveDuration rejects a zero or negative duration, which would later
+// panic in queue.Manager's ticker.Reset.
+func positiveDuration(name string, d time.Duration) error {
+	if d <= 0 {
+		return fmt.Errorf("%s: must be positive, got %s", name, d)
+	}
+	return nil
 }
 
-var (
-	config       Config
-	client       *http.Client
-	messageQueue chan Message
-	done         = make(chan struct{})
-)
-
 func InitializeConfig() {
 	flag.StringVar(&config.ApiKey, "apiKey", "", "API key for authentication")
 	flag.DurationVar(&config.FlushInterval, "flushInterval", 250*time.Millisecond, "Flush interval for batching")
@@ -83,286 +88,292 @@ func InitializeConfig() {
 	flag.Float64Var(&config.TargetMemPercent, "targetMem", 80.0, "Target memory usage percentage")
 	flag.DurationVar(&config.MinBatchInterval, "minInterval", 100*time.Millisecond, "Minimum batch interval")
 	flag.DurationVar(&config.MaxBatchInterval, "maxInterval", 1*time.Second, "Maximum batch interval")
+	flag.IntVar(&config.MaxRetries, "maxRetries", 5, "Maximum delivery attempts before dead-lettering a message")
+	flag.DurationVar(&config.RetryBaseDelay, "retryBaseDelay", 500*time.Millisecond, "Base delay for exponential backoff between retries")
+	flag.StringVar(&config.Compress, "compress", "none", "Batch upload compression: none, gzip, or zstd")
+	flag.IntVar(&config.GzipLevel, "gzipLevel", queue.DefaultGzipLevel, "Gzip compression level (1-9), used when --compress=gzip")
+
+	defaultTransport := transport.TransportUnix
+	if runtime.GOOS == "windows" {
+		defaultTransport = transport.TransportNPipe
+	}
+	flag.StringVar(&config.Transport, "transport", defaultTransport, "Socket transport: unix, npipe, or tcp+mtls")
+	flag.StringVar(&config.PipeName, "pipe-name", "tendrl_agent", "Named pipe name, used when --transport=npipe")
+	flag.StringVar(&config.ListenAddr, "listen-addr", "127.0.0.1:8443", "TCP listen address, used when --transport=tcp+mtls")
+	flag.StringVar(&config.TLSCert, "tls-cert", "", "Server certificate path, used when --transport=tcp+mtls")
+	flag.StringVar(&config.TLSKey, "tls-key", "", "Server key path, used when --transport=tcp+mtls")
+	flag.StringVar(&config.TLSClientCA, "tls-client-ca", "", "Client CA path for mTLS, used when --transport=tcp+mtls")
+	flag.StringVar(&config.ConfigFile, "config", "", "Path to a YAML/JSON file overriding tuning and the API key; flags win over the file on first load, and the file is re-read on SIGHUP")
 	flag.Parse()
 
-	if config.ApiKey == "" {
-		config.ApiKey = os.Getenv("TENDRL_KEY")
-		if config.ApiKey == "" {
-			fmt.Println("Exiting: Missing API key")
+	if config.ConfigFile != "" {
+		fc, err := loadFileConfig(config.ConfigFile)
+		if err != nil {
+			fmt.Printf("Exiting: failed to load --config file %q: %v\n", config.ConfigFile, err)
 			os.Exit(1)
 		}
-	}
 
-	config.AppURL = "https://app.tendrl.com/api"
+		explicitFlags := map[string]bool{}
+		flag.Visit(func(f *flag.Flag) { explicitFlags[f.Name] = true })
 
-	// Set platform-appropriate defaults for Unix socket paths
-	if runtime.GOOS == "windows" {
-		config.LinuxPath = "C:\\ProgramData\\tendrl"
-		config.SocketPath = config.LinuxPath + "\\tendrl_agent.sock"
-		fmt.Printf("Windows detected: Using AF_UNIX socket at %s\n", config.SocketPath)
-	} else {
-		config.LinuxPath = "/var/lib/tendrl"
-		config.SocketPath = config.LinuxPath + "/tendrl_agent.sock"
-		fmt.Printf("Unix/Linux detected: Using AF_UNIX socket at %s\n", config.SocketPath)
+		if err := applyFileConfig(&config, fc, explicitFlags); err != nil {
+			fmt.Printf("Exiting: invalid --config file %q: %v\n", config.ConfigFile, err)
+			os.Exit(1)
+		}
 	}
-}
 
-func ValidateClientContext(ctx *MessageContext) error {
-	if ctx != nil && len(ctx.Tags) > 10 {
-		return fmt.Errorf("too many tags provided; maximum is 10")
+	switch config.Compress {
+	case "none", "gzip", "zstd":
+	default:
+		fmt.Printf("Exiting: invalid --compress value %q, must be none, gzip, or zstd\n", config.Compress)
+		os.Exit(1)
 	}
-	return nil
-}
-
-func HandleConnection(conn net.Conn) {
-	defer conn.Close()
-	decoder := json.NewDecoder(bufio.NewReader(conn))
 
-	for {
-		var msg Message
-		if err := decoder.Decode(&msg); err == io.EOF {
-			fmt.Println("Connection closed by client")
-			break
-		} else if err != nil {
-			fmt.Printf("Error decoding JSON message: %v\n", err)
-			continue
-		}
-
-		err := ValidateClientContext(&msg.Context)
-		if err != nil {
-			log.Print(err)
-			sendErrorResponse(conn, err.Error())
-			continue
+	if config.Compress == "gzip" {
+		if config.GzipLevel < gzip.HuffmanOnly || config.GzipLevel > gzip.BestCompression {
+			fmt.Printf("Exiting: invalid --gzipLevel value %d, must be %d-%d\n", config.GzipLevel, gzip.HuffmanOnly, gzip.BestCompression)
+			os.Exit(1)
 		}
+	}
 
-		ProcessMessage(conn, msg)
+	if err := positiveDuration("minInterval", config.MinBatchInterval); err != nil {
+		fmt.Printf("Exiting: %v\n", err)
+		os.Exit(1)
+	}
+	if err := positiveDuration("maxInterval", config.MaxBatchInterval); err != nil {
+		fmt.Printf("Exiting: %v\n", err)
+		os.Exit(1)
 	}
-}
 
-func ProcessMessage(conn net.Conn, msg Message) {
-	if len(msg.Context.Tags) > 0 {
-		fmt.Printf("Processing message with tags: %v\n", msg.Context.Tags)
+	switch config.Transport {
+	case transport.TransportUnix, transport.TransportNPipe, transport.TransportTCPMTLS:
+	default:
+		fmt.Printf("Exiting: invalid --transport value %q, must be unix, npipe, or tcp+mtls\n", config.Transport)
+		os.Exit(1)
 	}
 
-	switch msg.MsgType {
-	case "msg_check":
-		limit := 1
-		var ok bool
-		if msg.Context.Limit != nil {
-			limit, ok = msg.Context.Limit.(int)
-			if !ok {
-				sendErrorResponse(conn, "Invalid limit type")
-				return
-			}
+	if config.ApiKey == "" {
+		config.ApiKey = os.Getenv("TENDRL_KEY")
+		if config.ApiKey == "" {
+			fmt.Println("Exiting: Missing API key")
+			os.Exit(1)
 		}
+	}
 
-		messages, err := checkMessage(client, limit)
-		if err != nil {
-			sendErrorResponse(conn, err.Error())
-			return
-		}
+	config.AppURL = "https://app.tendrl.com/api"
 
-		if len(messages) == 0 {
-			conn.Write([]byte("204"))
-			return
+	// Set platform-appropriate defaults for the storage directory and the
+	// AF_UNIX socket path (still available as --transport=unix on Windows),
+	// unless the --config file already supplied one.
+	if config.LinuxPath == "" {
+		if runtime.GOOS == "windows" {
+			config.LinuxPath = "C:\\ProgramData\\tendrl"
+		} else {
+			config.LinuxPath = "/var/lib/tendrl"
 		}
-		response, _ := json.Marshal(messages)
-		conn.Write(response)
-
-	case "publish":
-		if msg.Context.WaitResponse {
-			resp := sendSingleMessage(msg)
-			response, _ := json.Marshal(resp)
-			conn.Write(response)
-			return
+	}
+	if config.SocketPath == "" {
+		if runtime.GOOS == "windows" {
+			config.SocketPath = config.LinuxPath + "\\tendrl_agent.sock"
+		} else {
+			config.SocketPath = config.LinuxPath + "/tendrl_agent.sock"
 		}
-
-		messageQueue <- msg
-
-	default:
-		sendErrorResponse(conn, "Unknown message type")
 	}
+	fmt.Printf("Using %q transport\n", config.Transport)
+
+	currentCfg.Store(&config)
 }
 
-func getSystemMetrics() SystemMetrics {
-	var metrics SystemMetrics
+// fileConfig is the --config file's schema: every field is optional, so a
+// nil pointer means "not present in the file" rather than a zero value.
+// Durations are strings parsed with time.ParseDuration (e.g. "250ms").
+type fileConfig struct {
+	ApiKey           *string  `yaml:"apiKey"`
+	MinBatchSize     *int     `yaml:"minBatchSize"`
+	MaxBatchSize     *int     `yaml:"maxBatchSize"`
+	ScaleFactor      *float64 `yaml:"scaleFactor"`
+	MaxQueueSize     *int     `yaml:"maxQueue"`
+	TargetCPUPercent *float64 `yaml:"targetCPU"`
+	TargetMemPercent *float64 `yaml:"targetMem"`
+	MinBatchInterval *string  `yaml:"minInterval"`
+	MaxBatchInterval *string  `yaml:"maxInterval"`
+	MaxRetries       *int     `yaml:"maxRetries"`
+	RetryBaseDelay   *string  `yaml:"retryBaseDelay"`
+	SocketPath       *string  `yaml:"socketPath"`
+	LinuxPath        *string  `yaml:"linuxPath"`
+}
 
-	// Get CPU usage
-	cpuPercent, err := cpu.Percent(100*time.Millisecond, false)
-	if err == nil && len(cpuPercent) > 0 {
-		metrics.CPUUsage = cpuPercent[0]
+// loadFileConfig reads and parses a --config file. yaml.v3 also accepts
+// plain JSON, since JSON is a subset of YAML, so one loader covers both.
+func loadFileConfig(path string) (fileConfig, error) {
+	var fc fileConfig
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fc, err
 	}
-
-	// Get memory usage
-	vm, err := mem.VirtualMemory()
-	if err == nil {
-		metrics.MemoryUsage = vm.UsedPercent
+	if err := yaml.Unmarshal(data, &fc); err != nil {
+		return fc, err
 	}
-
-	// Calculate queue load
-	metrics.QueueLoad = float64(len(messageQueue)) / float64(config.MaxQueueSize) * 100
-
-	return metrics
+	return fc, nil
 }
 
-func calculateDynamicBatchSize(metrics SystemMetrics) int {
-	// Reduce batch size if system is under pressure
-	cpuFactor := math.Max(0, 1-(metrics.CPUUsage/config.TargetCPUPercent))
-	memFactor := math.Max(0, 1-(metrics.MemoryUsage/config.TargetMemPercent))
-	queueFactor := math.Min(1, metrics.QueueLoad/50) // Increase batch size if queue is filling up
-
-	// Combine factors (weighted average)
-	resourceFactor := (cpuFactor*0.4 + memFactor*0.4 + queueFactor*0.2)
-
-	// Calculate new batch size
-	newBatchSize := int(float64(config.MaxBatchSize) * resourceFactor)
-
-	// Ensure we stay within bounds
-	if newBatchSize < config.MinBatchSize {
-		return config.MinBatchSize
+// applyFileConfig merges fc onto cfg in place. skip, if non-nil, names
+// flags whose value was explicitly set on the command line and so should
+// win over the file (used on first load only; reloads pass a nil skip so
+// the file always takes effect).
+func applyFileConfig(cfg *Config, fc fileConfig, skip map[string]bool) error {
+	if fc.ApiKey != nil && !skip["apiKey"] {
+		cfg.ApiKey = *fc.ApiKey
 	}
-	if newBatchSize > config.MaxBatchSize {
-		return config.MaxBatchSize
+	if fc.MinBatchSize != nil && !skip["minBatchSize"] {
+		cfg.MinBatchSize = *fc.MinBatchSize
 	}
-
-	return newBatchSize
-}
-
-func ProcessQueue() {
-	batch := make([]Message, 0, config.MaxBatchSize)
-	ticker := time.NewTicker(config.MinBatchInterval)
-
-	for {
-		select {
-		case msg := <-messageQueue:
-			batch = append(batch, msg)
-
-			// Get current system metrics
-			metrics := getSystemMetrics()
-
-			// Calculate dynamic batch size based on system load
-			dynamicBatchSize := calculateDynamicBatchSize(metrics)
-
-			// Adjust ticker interval based on system load
-			interval := time.Duration(float64(config.MaxBatchInterval) *
-				(1 - metrics.QueueLoad/100))
-			if interval < config.MinBatchInterval {
-				interval = config.MinBatchInterval
-			}
-			ticker.Reset(interval)
-
-			if len(batch) >= dynamicBatchSize {
-				FlushBatch(batch)
-				batch = batch[:0]
-			}
-
-		case <-ticker.C:
-			if len(batch) > 0 {
-				FlushBatch(batch)
-				batch = batch[:0]
-			}
-
-		case <-done:
-			close(messageQueue) // Prevent further writes
-			for msg := range messageQueue {
-				batch = append(batch, msg)
-			}
-			if len(batch) > 0 {
-				FlushBatch(batch)
-			}
-			ticker.Stop()
-			return
+	if fc.MaxBatchSize != nil && !skip["maxBatchSize"] {
+		cfg.MaxBatchSize = *fc.MaxBatchSize
+	}
+	if fc.ScaleFactor != nil && !skip["scaleFactor"] {
+		cfg.ScaleFactor = *fc.ScaleFactor
+	}
+	if fc.MaxQueueSize != nil && !skip["maxQueue"] {
+		cfg.MaxQueueSize = *fc.MaxQueueSize
+	}
+	if fc.TargetCPUPercent != nil && !skip["targetCPU"] {
+		cfg.TargetCPUPercent = *fc.TargetCPUPercent
+	}
+	if fc.TargetMemPercent != nil && !skip["targetMem"] {
+		cfg.TargetMemPercent = *fc.TargetMemPercent
+	}
+	if fc.MinBatchInterval != nil && !skip["minInterval"] {
+		d, err := time.ParseDuration(*fc.MinBatchInterval)
+		if err != nil {
+			return fmt.Errorf("minInterval: %w", err)
 		}
+		if err := positiveDuration("minInterval", d); err != nil {
+			return err
+		}
+		cfg.MinBatchInterval = d
 	}
-}
-
-func FlushBatch(batch []Message) {
-	payload, err := json.Marshal(batch)
-	if err != nil {
-		fmt.Printf("Error marshalling batch: %v\n", err)
-		return
+	if fc.MaxBatchInterval != nil && !skip["maxInterval"] {
+		d, err := time.ParseDuration(*fc.MaxBatchInterval)
+		if err != nil {
+			return fmt.Errorf("maxInterval: %w", err)
+		}
+		if err := positiveDuration("maxInterval", d); err != nil {
+			return err
+		}
+		cfg.MaxBatchInterval = d
 	}
-
-	fmt.Printf("Flushing batch with %d messages...\n", len(batch))
-	req, err := http.NewRequest("POST", config.AppURL+"/messages", bytes.NewBuffer(payload))
-	if err != nil {
-		fmt.Printf("Error creating request: %v\n", err)
-		return
+	if fc.MaxRetries != nil && !skip["maxRetries"] {
+		cfg.MaxRetries = *fc.MaxRetries
 	}
-	req.Header.Set("Authorization", "Bearer "+config.ApiKey)
-	req.Header.Set("Content-Type", "application/json")
-
-	resp, err := client.Do(req)
-	if err != nil {
-		fmt.Printf("Error sending batch: %v\n", err)
-		return
+	if fc.RetryBaseDelay != nil && !skip["retryBaseDelay"] {
+		d, err := time.ParseDuration(*fc.RetryBaseDelay)
+		if err != nil {
+			return fmt.Errorf("retryBaseDelay: %w", err)
+		}
+		cfg.RetryBaseDelay = d
 	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusCreated {
-		body, _ := io.ReadAll(resp.Body)
-		fmt.Printf("Failed to send batch, status: %d, body: %s\n", resp.StatusCode, string(body))
+	if fc.SocketPath != nil {
+		cfg.SocketPath = *fc.SocketPath
 	}
-}
-
-func sendErrorResponse(conn net.Conn, errorMsg string) {
-	resp := ResponseMessage{
-		Status:  "error",
-		Message: errorMsg,
+	if fc.LinuxPath != nil {
+		cfg.LinuxPath = *fc.LinuxPath
 	}
-	data, _ := json.Marshal(resp)
-	conn.Write(data)
+	return nil
 }
 
 func main() {
 	InitializeConfig()
+	cfg := currentConfig()
 
-	// Initialize message queue with configured size
-	messageQueue = make(chan Message, config.MaxQueueSize)
-
-	CreateDirs(config.LinuxPath)
+	db, err := platform.CreateDirs(cfg.LinuxPath)
+	if err != nil {
+		fmt.Printf("[main] Failed to initialize storage: %v\n", err)
+		os.Exit(1)
+	}
+	defer db.Close()
 
-	client = &http.Client{
+	client := &http.Client{
 		Timeout: 10 * time.Second,
 	}
 
-	// On Windows, check if AF_UNIX is supported
-	if runtime.GOOS == "windows" {
-		if !isWindowsAFUnixSupported() {
+	qcfg := queue.Config{
+		MinBatchSize:     cfg.MinBatchSize,
+		MaxBatchSize:     cfg.MaxBatchSize,
+		ScaleFactor:      cfg.ScaleFactor,
+		MaxQueueSize:     cfg.MaxQueueSize,
+		TargetCPUPercent: cfg.TargetCPUPercent,
+		TargetMemPercent: cfg.TargetMemPercent,
+		MinBatchInterval: cfg.MinBatchInterval,
+		MaxBatchInterval: cfg.MaxBatchInterval,
+		MaxRetries:       cfg.MaxRetries,
+		RetryBaseDelay:   cfg.RetryBaseDelay,
+		ApiKey:           cfg.ApiKey,
+	}
+	sink := queue.NewHTTPSink(client, cfg.AppURL+"/messages", cfg.ApiKey, queue.CompressionMode(cfg.Compress), cfg.GzipLevel)
+	mgr := queue.NewManager(db, qcfg, sysinfo.GetSystemMetrics, sink)
+	if err := mgr.Init(); err != nil {
+		fmt.Printf("[main] Failed to initialize queue buckets: %v\n", err)
+		os.Exit(1)
+	}
+
+	srv := transport.NewServer(mgr, client, transport.Config{AppURL: cfg.AppURL, ApiKey: cfg.ApiKey})
+
+	// On Windows, AF_UNIX requires 1803+; the npipe transport has no such
+	// caveat, which is why it's the Windows default.
+	if runtime.GOOS == "windows" && cfg.Transport == transport.TransportUnix {
+		if !platform.IsWindowsAFUnixSupported() {
 			fmt.Println("Error: AF_UNIX sockets not supported on this Windows version.")
-			fmt.Println("Please upgrade to Windows 10 version 1803 or later.")
+			fmt.Println("Please upgrade to Windows 10 version 1803 or later, or use --transport=npipe.")
 			os.Exit(1)
 		}
 	}
 
-	// Remove existing socket file
-	os.Remove(config.SocketPath)
-
-	// Create Unix socket listener on all platforms
-	listener, err := net.Listen("unix", config.SocketPath)
+	listener, err := newListener(cfg)
 	if err != nil {
-		fmt.Printf("[main] AF_UNIX Listener error: %v\n", err)
-		if runtime.GOOS == "windows" {
-			fmt.Println("Hint: Ensure Windows 10 1803+ and AF_UNIX driver is enabled")
-			fmt.Println("Check with: sc query afunix")
-		}
+		fmt.Printf("[main] Listener error: %v\n", err)
 		os.Exit(1)
 	}
 	defer listener.Close()
 
-	fmt.Printf("Agent listening on AF_UNIX socket: %s\n", config.SocketPath)
+	fmt.Printf("Agent listening on %s transport\n", cfg.Transport)
 
-	go ProcessQueue()
+	go mgr.Run()
 
+	if err := mgr.Replay(); err != nil {
+		fmt.Printf("[main] Failed to replay pending messages: %v\n", err)
+	}
+
+	notifier := platform.NewNotifier()
+
+	done := make(chan struct{})
 	signalChannel := make(chan os.Signal, 1)
 	signal.Notify(signalChannel, os.Interrupt, syscall.SIGTERM)
 	go func() {
 		<-signalChannel
+		notifier.Stopping()
 		close(done)
+		mgr.Stop()
 		fmt.Println("[main] Shutting down gracefully...")
 		listener.Close()
 	}()
 
+	reloadChannel := make(chan os.Signal, 1)
+	signal.Notify(reloadChannel, syscall.SIGHUP)
+	go func() {
+		for {
+			select {
+			case <-reloadChannel:
+				reloadConfig(mgr, srv)
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	notifier.Ready()
+	go reportStatus(notifier, mgr, done)
+
 	for {
 		conn, err := listener.Accept()
 		if err != nil {
@@ -374,79 +385,121 @@ func main() {
 				continue
 			}
 		}
-		go HandleConnection(conn)
+		go srv.HandleConnection(conn)
 	}
 }
 
-// isWindowsAFUnixSupported checks if Windows supports AF_UNIX sockets
-func isWindowsAFUnixSupported() bool {
-	// Try to create a test Unix socket to verify support
-	testSocket, err := net.Listen("unix", "test_afunix.sock")
-	if err != nil {
-		return false
+// newListener builds the configured transport's listener. For the unix
+// transport it first gives systemd a chance to hand over a socket-activated
+// listener before creating one itself.
+func newListener(cfg Config) (net.Listener, error) {
+	if cfg.Transport == transport.TransportUnix {
+		listener, adopted, err := platform.ListenFromSystemd()
+		if err != nil {
+			return nil, err
+		}
+		if adopted {
+			fmt.Println("Agent adopted socket-activated listener from systemd")
+			return listener, nil
+		}
 	}
-	testSocket.Close()
-	os.Remove("test_afunix.sock")
-	return true
+
+	return transport.Listen(transport.ListenerConfig{
+		Transport:   cfg.Transport,
+		SocketPath:  cfg.SocketPath,
+		PipeName:    cfg.PipeName,
+		ListenAddr:  cfg.ListenAddr,
+		TLSCert:     cfg.TLSCert,
+		TLSKey:      cfg.TLSKey,
+		TLSClientCA: cfg.TLSClientCA,
+	})
 }
 
-func checkMessage(client *http.Client, limit int) ([]Message, error) {
-	url := fmt.Sprintf("%s/entities/check_messages?limit=%d", config.AppURL, limit)
+// reportStatus periodically sends the current queue depth and last
+// successful flush time to systemd via STATUS= lines, until done is closed.
+func reportStatus(notifier *platform.Notifier, mgr *queue.Manager, done <-chan struct{}) {
+	ticker := time.NewTicker(10 * time.Second)
+	defer ticker.Stop()
 
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		return nil, err
+	for {
+		select {
+		case <-ticker.C:
+			notifier.Status(fmt.Sprintf("queue depth=%d, last flush=%s", mgr.Len(), mgr.LastFlush().Format(time.RFC3339)))
+		case <-done:
+			return
+		}
 	}
+}
 
-	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", config.ApiKey))
-	req.Header.Set("Content-Type", "application/json")
-
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, err
+// reloadConfig re-reads the --config file on SIGHUP and atomically swaps
+// currentCfg, so operators can rotate TENDRL_KEY or retune batching without
+// a restart. Reloads that would change SocketPath or LinuxPath are rejected
+// since those require re-creating the listener and storage directory.
+func reloadConfig(mgr *queue.Manager, srv *transport.Server) {
+	cfg := currentConfig()
+	if cfg.ConfigFile == "" {
+		fmt.Println("[reload] SIGHUP received but no --config file was given, ignoring")
+		return
 	}
-	defer resp.Body.Close()
 
-	// Match Python's status code handling
-	if resp.StatusCode == 204 {
-		return nil, nil
+	fc, err := loadFileConfig(cfg.ConfigFile)
+	if err != nil {
+		fmt.Printf("[reload] Failed to load %s: %v\n", cfg.ConfigFile, err)
+		return
 	}
 
-	if resp.StatusCode != 200 {
-		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	next := cfg
+	if err := applyFileConfig(&next, fc, nil); err != nil {
+		fmt.Printf("[reload] Invalid config in %s: %v\n", cfg.ConfigFile, err)
+		return
 	}
 
-	var response struct {
-		Messages []Message `json:"messages"`
-	}
-	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
-		return nil, err
+	if next.SocketPath != cfg.SocketPath || next.LinuxPath != cfg.LinuxPath {
+		fmt.Printf("[reload] Rejected: SocketPath/LinuxPath changes require a restart\n")
+		return
 	}
 
-	return response.Messages, nil
+	logConfigDiff(cfg, next)
+	currentCfg.Store(&next)
+
+	mgr.UpdateConfig(queue.Config{
+		MinBatchSize:     next.MinBatchSize,
+		MaxBatchSize:     next.MaxBatchSize,
+		ScaleFactor:      next.ScaleFactor,
+		MaxQueueSize:     next.MaxQueueSize,
+		TargetCPUPercent: next.TargetCPUPercent,
+		TargetMemPercent: next.TargetMemPercent,
+		MinBatchInterval: next.MinBatchInterval,
+		MaxBatchInterval: next.MaxBatchInterval,
+		MaxRetries:       next.MaxRetries,
+		RetryBaseDelay:   next.RetryBaseDelay,
+		ApiKey:           next.ApiKey,
+	})
+	srv.UpdateConfig(transport.Config{AppURL: next.AppURL, ApiKey: next.ApiKey})
+
+	fmt.Println("[reload] Config reloaded")
 }
 
-func sendSingleMessage(msg Message) interface{} {
-	payload, err := json.Marshal(msg)
-	if err != nil {
-		return map[string]string{"error": err.Error()}
-	}
-
-	req, err := http.NewRequest("POST", config.AppURL+"/entities/message", bytes.NewBuffer(payload))
-	if err != nil {
-		return map[string]string{"error": err.Error()}
+// logConfigDiff prints each tunable that changed between old and next, with
+// the API key masked, so a reload's effect is visible in the agent's log.
+func logConfigDiff(old, next Config) {
+	diff := func(name string, oldVal, newVal interface{}) {
+		if oldVal != newVal {
+			fmt.Printf("[reload] %s: %v -> %v\n", name, oldVal, newVal)
+		}
 	}
 
-	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", config.ApiKey))
-	req.Header.Set("Content-Type", "application/json")
-
-	resp, err := client.Do(req)
-	if err != nil {
-		return map[string]string{"error": err.Error()}
+	if old.ApiKey != next.ApiKey {
+		fmt.Println("[reload] apiKey: rotated")
 	}
-	defer resp.Body.Close()
-
-	var result interface{}
-	json.NewDecoder(resp.Body).Decode(&result)
-	return result
+	diff("minBatchSize", old.MinBatchSize, next.MinBatchSize)
+	diff("maxBatchSize", old.MaxBatchSize, next.MaxBatchSize)
+	diff("scaleFactor", old.ScaleFactor, next.ScaleFactor)
+	diff("maxQueue", old.MaxQueueSize, next.MaxQueueSize)
+	diff("targetCPU", old.TargetCPUPercent, next.TargetCPUPercent)
+	diff("targetMem", old.TargetMemPercent, next.TargetMemPercent)
+	diff("minInterval", old.MinBatchInterval, next.MinBatchInterval)
+	diff("maxInterval", old.MaxBatchInterval, next.MaxBatchInterval)
+	diff("maxRetries", old.MaxRetries, next.MaxRetries)
+	diff("retryBaseDelay", old.RetryBaseDelay, next.RetryBaseDelay)
 }
@@ -1,12 +1,11 @@
 //go:build !windows
 
-package main
+package platform
 
 import (
 	"fmt"
 	"os"
 	"os/exec"
-	"syscall"
 
 	bolt "go.etcd.io/bbolt"
 )
@@ -43,53 +42,38 @@ func setPermissions(dirPath, groupName string) error {
 	return nil
 }
 
-// CreateDirs sets up the environment, including directory creation and permissions
-func CreateDirs(dirPath string) error {
+// CreateDirs sets up the environment, including directory creation and
+// permissions, and returns the opened bbolt handle for the caller to own.
+func CreateDirs(dirPath string) (*bolt.DB, error) {
 	groupName := "tendrl"
 
 	// Create the group if it doesn't exist
 	if err := createGroup(groupName); err != nil {
-		return err
+		return nil, err
 	}
 
 	// Create the directory if it doesn't exist
 	if err := os.MkdirAll(dirPath, 0750); err != nil {
-		return fmt.Errorf("failed to create directory '%s': %w", dirPath, err)
+		return nil, fmt.Errorf("failed to create directory '%s': %w", dirPath, err)
 	}
 
 	// Set permissions for the directory
 	if err := setPermissions(dirPath, groupName); err != nil {
-		return err
+		return nil, err
 	}
 
 	// Initialize the database in the directory
 	db, err := bolt.Open(fmt.Sprintf("%s/tether.db", dirPath), 0660, nil)
 	if err != nil {
-		return fmt.Errorf("failed to open database: %w", err)
+		return nil, fmt.Errorf("failed to open database: %w", err)
 	}
-	defer db.Close()
 
 	fmt.Printf("Directory setup complete: %s\n", dirPath)
-	return nil
+	return db, nil
 }
 
-// Free calculates free memory and disk usage
-func Free() map[string]interface{} {
-	var stat syscall.Statfs_t
-	err := syscall.Statfs("/", &stat)
-	if err != nil {
-		return map[string]interface{}{
-			"error": "failed to get disk stats",
-		}
-	}
-
-	fsSize := stat.Blocks * uint64(stat.Bsize)
-	fsFree := stat.Bfree * uint64(stat.Bsize)
-	fsFreeHuman, fsFreeUnit := Convert(fsFree)
-	fsSizeHuman, fsSizeUnit := Convert(fsSize)
-
-	return map[string]interface{}{
-		"disk_free": fmt.Sprintf("%.2f %s", fsFreeHuman, fsFreeUnit),
-		"disk_size": fmt.Sprintf("%.2f %s", fsSizeHuman, fsSizeUnit),
-	}
+// IsWindowsAFUnixSupported always reports true on non-Windows platforms,
+// which natively support AF_UNIX.
+func IsWindowsAFUnixSupported() bool {
+	return true
 }
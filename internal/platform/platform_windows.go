@@ -1,9 +1,10 @@
 //go:build windows
 
-package main
+package platform
 
 import (
 	"fmt"
+	"net"
 	"os"
 	"os/exec"
 	"syscall"
@@ -26,19 +27,6 @@ var (
 	procSetNamedSecurityInfoW = advapi32.NewProc("SetNamedSecurityInfoW")
 )
 
-// MEMORYSTATUSEX represents the memory status structure used by GlobalMemoryStatusEx
-type MEMORYSTATUSEX struct {
-	Length               uint32
-	MemoryLoad           uint32
-	TotalPhys            uint64
-	AvailPhys            uint64
-	TotalPageFile        uint64
-	AvailPageFile        uint64
-	TotalVirtual         uint64
-	AvailVirtual         uint64
-	AvailExtendedVirtual uint64
-}
-
 // createGroup creates a local group (e.g., "tendrl") if it doesn't already exist
 func createGroup(groupName string) error {
 	cmd := exec.Command("net", "localgroup", groupName)
@@ -122,55 +110,39 @@ func setWindowsACL(dirPath, groupName string) error {
 	return nil
 }
 
-// Free calculates free memory and disk usage on Windows
-func Free() map[string]interface{} {
-	kernel32 := syscall.NewLazyDLL("kernel32.dll")
-	globalMemoryStatusEx := kernel32.NewProc("GlobalMemoryStatusEx")
-
-	memStatus := MEMORYSTATUSEX{
-		Length: uint32(unsafe.Sizeof(MEMORYSTATUSEX{})),
-	}
-
-	// Call the GlobalMemoryStatusEx function
-	ret, _, err := globalMemoryStatusEx.Call(uintptr(unsafe.Pointer(&memStatus)))
-	if ret == 0 {
-		return map[string]interface{}{
-			"error": fmt.Sprintf("failed to get memory stats: %v", err),
-		}
-	}
-
-	// Convert memory stats to human-readable format
-	availPhysHuman, availUnit := Convert(memStatus.AvailPhys)
-	totalPhysHuman, totalUnit := Convert(memStatus.TotalPhys)
-
-	return map[string]interface{}{
-		"mem_free":  fmt.Sprintf("%.2f %s", availPhysHuman, availUnit),
-		"mem_total": fmt.Sprintf("%.2f %s", totalPhysHuman, totalUnit),
-	}
-}
-
-// CreateDirs sets up the environment, including directory creation and permissions
-func CreateDirs(dirPath string) error {
+// CreateDirs sets up the environment, including directory creation and
+// permissions, and returns the opened bbolt handle for the caller to own.
+func CreateDirs(dirPath string) (*bolt.DB, error) {
 	groupName := "tendrl"
 
 	if err := createGroup(groupName); err != nil {
-		return err
+		return nil, err
 	}
 
 	if err := os.MkdirAll(dirPath, 0750); err != nil {
-		return fmt.Errorf("failed to create directory '%s': %w", dirPath, err)
+		return nil, fmt.Errorf("failed to create directory '%s': %w", dirPath, err)
 	}
 
 	if err := setWindowsACL(dirPath, groupName); err != nil {
-		return fmt.Errorf("failed to set ACL: %w", err)
+		return nil, fmt.Errorf("failed to set ACL: %w", err)
 	}
 
 	db, err := bolt.Open(fmt.Sprintf("%s\\tether.db", dirPath), 0660, nil)
 	if err != nil {
-		return fmt.Errorf("failed to open database: %w", err)
+		return nil, fmt.Errorf("failed to open database: %w", err)
 	}
-	defer db.Close()
 
 	fmt.Printf("Directory setup complete: %s\n", dirPath)
-	return nil
+	return db, nil
+}
+
+// IsWindowsAFUnixSupported checks if Windows supports AF_UNIX sockets
+func IsWindowsAFUnixSupported() bool {
+	testSocket, err := net.Listen("unix", "test_afunix.sock")
+	if err != nil {
+		return false
+	}
+	testSocket.Close()
+	os.Remove("test_afunix.sock")
+	return true
 }
@@ -0,0 +1,90 @@
+//go:build linux
+
+package platform
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+)
+
+// systemdListenerFD is the first file descriptor systemd passes to a
+// socket-activated unit (fd 0-2 are stdio).
+const systemdListenerFD = 3
+
+// ListenFromSystemd adopts a socket-activated listener passed by systemd
+// via LISTEN_FDS/LISTEN_PID, so the unit (not the agent) owns creating and
+// chown-ing the socket file. ok is false, with no error, whenever the
+// activation env vars are absent or don't target this process, and the
+// caller should fall back to creating its own listener.
+func ListenFromSystemd() (listener net.Listener, ok bool, err error) {
+	pidStr := os.Getenv("LISTEN_PID")
+	fdsStr := os.Getenv("LISTEN_FDS")
+	if pidStr == "" || fdsStr == "" {
+		return nil, false, nil
+	}
+
+	pid, err := strconv.Atoi(pidStr)
+	if err != nil || pid != os.Getpid() {
+		return nil, false, nil
+	}
+
+	fds, err := strconv.Atoi(fdsStr)
+	if err != nil || fds < 1 {
+		return nil, false, nil
+	}
+
+	file := os.NewFile(uintptr(systemdListenerFD), "systemd-socket")
+	listener, err = net.FileListener(file)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to adopt systemd socket: %w", err)
+	}
+	return listener, true, nil
+}
+
+// Notifier sends sd_notify-style readiness and status messages to systemd
+// over $NOTIFY_SOCKET. It is a no-op when NOTIFY_SOCKET is unset, e.g. when
+// not running under systemd.
+type Notifier struct {
+	conn net.Conn
+}
+
+// NewNotifier dials $NOTIFY_SOCKET if set.
+func NewNotifier() *Notifier {
+	addr := os.Getenv("NOTIFY_SOCKET")
+	if addr == "" {
+		return &Notifier{}
+	}
+
+	conn, err := net.Dial("unixgram", addr)
+	if err != nil {
+		fmt.Printf("[platform] Failed to connect to NOTIFY_SOCKET: %v\n", err)
+		return &Notifier{}
+	}
+	return &Notifier{conn: conn}
+}
+
+func (n *Notifier) send(state string) {
+	if n.conn == nil {
+		return
+	}
+	if _, err := n.conn.Write([]byte(state)); err != nil {
+		fmt.Printf("[platform] Failed to notify systemd: %v\n", err)
+	}
+}
+
+// Ready sends READY=1, telling systemd the unit has finished starting.
+func (n *Notifier) Ready() {
+	n.send("READY=1")
+}
+
+// Status sends a free-form STATUS= line shown in `systemctl status`.
+func (n *Notifier) Status(status string) {
+	n.send("STATUS=" + status)
+}
+
+// Stopping sends STOPPING=1, telling systemd a graceful shutdown is underway.
+func (n *Notifier) Stopping() {
+	n.send("STOPPING=1")
+}
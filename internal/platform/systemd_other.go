@@ -0,0 +1,23 @@
+//go:build !linux
+
+package platform
+
+import "net"
+
+// ListenFromSystemd is a no-op outside Linux; socket activation is a
+// systemd concept. Callers always fall back to creating their own listener.
+func ListenFromSystemd() (listener net.Listener, ok bool, err error) {
+	return nil, false, nil
+}
+
+// Notifier is a no-op outside Linux.
+type Notifier struct{}
+
+// NewNotifier returns a Notifier whose methods do nothing.
+func NewNotifier() *Notifier {
+	return &Notifier{}
+}
+
+func (n *Notifier) Ready()               {}
+func (n *Notifier) Status(status string) {}
+func (n *Notifier) Stopping()            {}
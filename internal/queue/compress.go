@@ -0,0 +1,126 @@
+package queue
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// CompressionMode selects how FlushBatch payloads are encoded before being
+// handed to the sink.
+type CompressionMode string
+
+const (
+	CompressionNone CompressionMode = "none"
+	CompressionGzip CompressionMode = "gzip"
+	CompressionZstd CompressionMode = "zstd"
+)
+
+// DefaultGzipLevel matches gzip's "default" compromise between speed and
+// ratio without importing gzip.DefaultCompression at every call site.
+const DefaultGzipLevel = 5
+
+// gzipPool pairs a pool of ready-to-use writers with the error from
+// validating its level, so an out-of-range level (anything outside
+// gzip.HuffmanOnly..gzip.BestCompression) surfaces as an error from
+// compressGzip instead of a nil *gzip.Writer panicking on Reset.
+type gzipPool struct {
+	pool *sync.Pool
+	err  error
+}
+
+var gzipWriterPools sync.Map // level (int) -> *gzipPool
+
+func gzipWriterPool(level int) *gzipPool {
+	if p, ok := gzipWriterPools.Load(level); ok {
+		return p.(*gzipPool)
+	}
+
+	gp := &gzipPool{}
+	if _, err := gzip.NewWriterLevel(io.Discard, level); err != nil {
+		gp.err = err
+	} else {
+		gp.pool = &sync.Pool{
+			New: func() interface{} {
+				w, _ := gzip.NewWriterLevel(nil, level)
+				return w
+			},
+		}
+	}
+
+	actual, _ := gzipWriterPools.LoadOrStore(level, gp)
+	return actual.(*gzipPool)
+}
+
+// compressGzip compresses payload at the given level, reusing pooled
+// writers since allocating one per flush is expensive.
+func compressGzip(payload []byte, level int) ([]byte, error) {
+	gp := gzipWriterPool(level)
+	if gp.err != nil {
+		return nil, fmt.Errorf("invalid gzip level %d: %w", level, gp.err)
+	}
+
+	w := gp.pool.Get().(*gzip.Writer)
+	defer gp.pool.Put(w)
+
+	var buf bytes.Buffer
+	w.Reset(&buf)
+	if _, err := w.Write(payload); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+var zstdEncoderPool = sync.Pool{
+	New: func() interface{} {
+		enc, _ := zstd.NewWriter(nil)
+		return enc
+	},
+}
+
+// compressZstd compresses payload, reusing a pooled *zstd.Encoder since
+// allocating one per flush is expensive.
+func compressZstd(payload []byte) ([]byte, error) {
+	enc := zstdEncoderPool.Get().(*zstd.Encoder)
+	defer zstdEncoderPool.Put(enc)
+
+	var buf bytes.Buffer
+	enc.Reset(&buf)
+	if _, err := enc.Write(payload); err != nil {
+		return nil, err
+	}
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// compress encodes payload per mode, falling back to the uncompressed
+// payload (with an error) rather than dropping the batch on encoder failure.
+func compress(payload []byte, mode CompressionMode, gzipLevel int) (data []byte, encoding string, err error) {
+	switch mode {
+	case CompressionGzip:
+		compressed, cerr := compressGzip(payload, gzipLevel)
+		if cerr != nil {
+			return payload, "", fmt.Errorf("gzip compression failed, sending uncompressed: %w", cerr)
+		}
+		return compressed, "gzip", nil
+
+	case CompressionZstd:
+		compressed, cerr := compressZstd(payload)
+		if cerr != nil {
+			return payload, "", fmt.Errorf("zstd compression failed, sending uncompressed: %w", cerr)
+		}
+		return compressed, "zstd", nil
+
+	default:
+		return payload, "", nil
+	}
+}
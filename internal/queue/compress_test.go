@@ -0,0 +1,75 @@
+package queue
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"tendrl/agent/internal/transport"
+)
+
+// syntheticBatch builds a representative 200-message, tag-heavy batch for
+// comparing compression modes.
+func syntheticBatch(n int) []byte {
+	msgs := make([]transport.Message, n)
+	for i := range msgs {
+		msgs[i] = transport.Message{
+			Data:    fmt.Sprintf("synthetic payload line %d with some repeated filler text", i),
+			MsgType: "publish",
+			Context: transport.MessageContext{
+				Tags:   []string{"env:prod", "service:agent", "region:us-east-1", "team:platform"},
+				Entity: "host-0001",
+			},
+			Timestamp: "2026-07-29T00:00:00Z",
+		}
+	}
+	payload, _ := json.Marshal(msgs)
+	return payload
+}
+
+// TestCompressInvalidGzipLevelFallsBack verifies an out-of-range gzip level
+// returns an error and the original payload instead of panicking on a nil
+// pooled writer.
+func TestCompressInvalidGzipLevelFallsBack(t *testing.T) {
+	payload := syntheticBatch(1)
+
+	data, encoding, err := compress(payload, CompressionGzip, 37)
+	if err == nil {
+		t.Fatal("expected an error for an invalid gzip level, got nil")
+	}
+	if encoding != "" {
+		t.Fatalf("expected no encoding on fallback, got %q", encoding)
+	}
+	if string(data) != string(payload) {
+		t.Fatal("expected the original payload to be returned on fallback")
+	}
+
+	// A later call with a valid level must still succeed; the invalid
+	// level's pool entry must not poison the shared sync.Map.
+	if _, _, err := compress(payload, CompressionGzip, DefaultGzipLevel); err != nil {
+		t.Fatalf("compress with a valid level failed after an invalid one: %v", err)
+	}
+}
+
+// BenchmarkCompress compares wire size and CPU cost across compression
+// modes for a synthetic 200-message batch.
+func BenchmarkCompress(b *testing.B) {
+	payload := syntheticBatch(200)
+
+	modes := []CompressionMode{CompressionNone, CompressionGzip, CompressionZstd}
+	for _, mode := range modes {
+		b.Run(string(mode), func(b *testing.B) {
+			var size int
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				data, _, err := compress(payload, mode, DefaultGzipLevel)
+				if err != nil {
+					b.Fatalf("compress(%s) failed: %v", mode, err)
+				}
+				size = len(data)
+			}
+			b.ReportMetric(float64(size), "bytes/op")
+			b.ReportMetric(float64(size)/float64(len(payload))*100, "pct-of-original")
+		})
+	}
+}
@@ -0,0 +1,15 @@
+package queue
+
+import "encoding/binary"
+
+// itob encodes a sequence number as a big-endian key so bbolt's natural
+// byte ordering keeps the outbox in insertion order.
+func itob(seq uint64) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, seq)
+	return b
+}
+
+func btoi(b []byte) uint64 {
+	return binary.BigEndian.Uint64(b)
+}
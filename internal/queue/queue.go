@@ -0,0 +1,457 @@
+// Package queue owns the agent's durable, adaptively-batched delivery
+// pipeline: messages are persisted to bbolt before being acknowledged to
+// the client, then drained in order, batched according to host load, and
+// POSTed to the app.
+package queue
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+
+	"tendrl/agent/internal/sysinfo"
+	"tendrl/agent/internal/transport"
+)
+
+var (
+	outboxBucket = []byte("outbox")
+	dlqBucket    = []byte("dlq")
+)
+
+// Config holds the batching and retry tuning knobs for a Manager. All
+// fields except MaxQueueSize (fixed at the in-memory channel's capacity)
+// can be changed at runtime via UpdateConfig.
+type Config struct {
+	MinBatchSize     int
+	MaxBatchSize     int
+	ScaleFactor      float64
+	MaxQueueSize     int
+	TargetCPUPercent float64
+	TargetMemPercent float64
+	MinBatchInterval time.Duration
+	MaxBatchInterval time.Duration
+	MaxRetries       int
+	RetryBaseDelay   time.Duration
+	ApiKey           string
+}
+
+// Sink delivers a marshaled batch to the app and reports the raw HTTP
+// status and body, so Manager can decide whether to ack or retry.
+type Sink interface {
+	Send(payload []byte) (statusCode int, body []byte, err error)
+}
+
+// apiKeySetter is implemented by sinks that support rotating their API key
+// without a restart. HTTPSink implements it.
+type apiKeySetter interface {
+	SetApiKey(key string)
+}
+
+// MetricsFunc supplies a point-in-time host load snapshot; Manager calls it
+// with its current in-memory queue depth on every enqueue.
+type MetricsFunc func(queueLen, maxQueueSize int) sysinfo.Metrics
+
+// queuedMessage pairs a Message with the bbolt sequence it was stored
+// under, so a batch can be acked or retried by key after a flush.
+type queuedMessage struct {
+	Seq uint64
+	Msg transport.Message
+}
+
+// outboxEntry is the on-disk representation of a queued message, tracking
+// how many times delivery has been attempted.
+type outboxEntry struct {
+	Msg      transport.Message `json:"msg"`
+	Attempts int               `json:"attempts"`
+}
+
+// Manager is the durable, adaptively-batched queue. It implements
+// transport.Queue.
+type Manager struct {
+	db      *bolt.DB
+	cfg     atomic.Pointer[Config]
+	metrics MetricsFunc
+	sink    Sink
+
+	ch      chan queuedMessage
+	retryCh chan queuedMessage
+	done    chan struct{}
+
+	mu        sync.Mutex
+	lastFlush time.Time
+}
+
+// NewManager builds a Manager backed by db, using metrics to drive batch
+// sizing and sink to deliver flushed batches.
+func NewManager(db *bolt.DB, cfg Config, metrics MetricsFunc, sink Sink) *Manager {
+	m := &Manager{
+		db:      db,
+		metrics: metrics,
+		sink:    sink,
+		ch:      make(chan queuedMessage, cfg.MaxQueueSize),
+		retryCh: make(chan queuedMessage, cfg.MaxQueueSize),
+		done:    make(chan struct{}),
+	}
+	m.cfg.Store(&cfg)
+	return m
+}
+
+// Config returns the Manager's current effective configuration.
+func (m *Manager) Config() Config {
+	return *m.cfg.Load()
+}
+
+// UpdateConfig atomically swaps the Manager's tuning configuration,
+// picking up on the next batching decision, and rotates the sink's API key
+// if it supports it. MaxQueueSize is accepted but has no effect on the
+// already-allocated channel capacity.
+func (m *Manager) UpdateConfig(cfg Config) {
+	m.cfg.Store(&cfg)
+	if setter, ok := m.sink.(apiKeySetter); ok {
+		setter.SetApiKey(cfg.ApiKey)
+	}
+}
+
+// EffectiveConfig reports the Manager's current tuning in a form suitable
+// for the "config_get" admin command; the API key itself is never exposed.
+func (m *Manager) EffectiveConfig() map[string]interface{} {
+	cfg := m.Config()
+	return map[string]interface{}{
+		"min_batch_size":     cfg.MinBatchSize,
+		"max_batch_size":     cfg.MaxBatchSize,
+		"scale_factor":       cfg.ScaleFactor,
+		"max_queue_size":     cfg.MaxQueueSize,
+		"target_cpu_percent": cfg.TargetCPUPercent,
+		"target_mem_percent": cfg.TargetMemPercent,
+		"min_batch_interval": cfg.MinBatchInterval.String(),
+		"max_batch_interval": cfg.MaxBatchInterval.String(),
+		"max_retries":        cfg.MaxRetries,
+		"retry_base_delay":   cfg.RetryBaseDelay.String(),
+		"api_key_set":        cfg.ApiKey != "",
+	}
+}
+
+// Init creates the outbox and dead-letter buckets if they don't already exist.
+func (m *Manager) Init() error {
+	return m.db.Update(func(tx *bolt.Tx) error {
+		if _, err := tx.CreateBucketIfNotExists(outboxBucket); err != nil {
+			return err
+		}
+		if _, err := tx.CreateBucketIfNotExists(dlqBucket); err != nil {
+			return err
+		}
+		return nil
+	})
+}
+
+// Len reports the number of messages currently buffered in memory,
+// awaiting a batch flush.
+func (m *Manager) Len() int {
+	return len(m.ch)
+}
+
+// Enqueue durably writes msg to the outbox bucket before it is acknowledged
+// to the client, then hands it to the in-memory queue for batching.
+func (m *Manager) Enqueue(msg transport.Message) (uint64, error) {
+	seq, err := m.persist(msg)
+	if err != nil {
+		return 0, err
+	}
+	m.ch <- queuedMessage{Seq: seq, Msg: msg}
+	return seq, nil
+}
+
+func (m *Manager) persist(msg transport.Message) (uint64, error) {
+	var seq uint64
+	err := m.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(outboxBucket)
+		s, err := bucket.NextSequence()
+		if err != nil {
+			return err
+		}
+		seq = s
+
+		data, err := json.Marshal(outboxEntry{Msg: msg})
+		if err != nil {
+			return err
+		}
+		return bucket.Put(itob(seq), data)
+	})
+	return seq, err
+}
+
+// Stats reports the current pending (outbox) and dead-letter counts.
+func (m *Manager) Stats() (pending int, dlq int, err error) {
+	err = m.db.View(func(tx *bolt.Tx) error {
+		pending = tx.Bucket(outboxBucket).Stats().KeyN
+		dlq = tx.Bucket(dlqBucket).Stats().KeyN
+		return nil
+	})
+	return
+}
+
+// Replay re-queues any messages left over in the outbox from a previous
+// run, so they are retried before the agent accepts new connections.
+func (m *Manager) Replay() error {
+	var pending []queuedMessage
+	err := m.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(outboxBucket)
+		return bucket.ForEach(func(k, v []byte) error {
+			var entry outboxEntry
+			if err := json.Unmarshal(v, &entry); err != nil {
+				return err
+			}
+			pending = append(pending, queuedMessage{Seq: btoi(k), Msg: entry.Msg})
+			return nil
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	if len(pending) > 0 {
+		fmt.Printf("Replaying %d un-acked message(s) from previous run\n", len(pending))
+	}
+	for _, qm := range pending {
+		m.ch <- qm
+	}
+	return nil
+}
+
+// Stop signals Run to drain the in-memory queue and flush a final batch.
+func (m *Manager) Stop() {
+	close(m.done)
+}
+
+// Run drains the in-memory queue, grouping messages into batches sized and
+// paced according to host load, and flushing them to the sink. It blocks
+// until Stop is called.
+func (m *Manager) Run() {
+	cfg := m.Config()
+	batch := make([]queuedMessage, 0, cfg.MaxBatchSize)
+	ticker := time.NewTicker(cfg.MinBatchInterval)
+
+	enqueue := func(qm queuedMessage) {
+		batch = append(batch, qm)
+
+		cfg := m.Config()
+		metrics := m.metrics(m.Len(), cfg.MaxQueueSize)
+		dynamicBatchSize := calculateDynamicBatchSize(metrics, cfg)
+
+		interval := time.Duration(float64(cfg.MaxBatchInterval) *
+			(1 - metrics.QueueLoad/100))
+		if interval < cfg.MinBatchInterval {
+			interval = cfg.MinBatchInterval
+		}
+		ticker.Reset(interval)
+
+		if len(batch) >= dynamicBatchSize {
+			m.FlushBatch(batch)
+			batch = batch[:0]
+		}
+	}
+
+	for {
+		select {
+		case qm := <-m.ch:
+			enqueue(qm)
+
+		case qm := <-m.retryCh:
+			// Owned by Run so a retry's time.AfterFunc never races the
+			// close of m.ch on shutdown; see retryOrDeadLetter.
+			enqueue(qm)
+
+		case <-ticker.C:
+			if len(batch) > 0 {
+				m.FlushBatch(batch)
+				batch = batch[:0]
+			}
+			// Re-read in case a SIGHUP changed MinBatchInterval while the
+			// queue was idle; enqueue's Reset alone never fires on an
+			// empty queue.
+			ticker.Reset(m.Config().MinBatchInterval)
+
+		case <-m.done:
+			close(m.ch) // Prevent further writes
+			for qm := range m.ch {
+				batch = append(batch, qm)
+			}
+		drainRetries:
+			for {
+				select {
+				case qm := <-m.retryCh:
+					batch = append(batch, qm)
+				default:
+					break drainRetries
+				}
+			}
+			if len(batch) > 0 {
+				m.FlushBatch(batch)
+			}
+			ticker.Stop()
+			return
+		}
+	}
+}
+
+// calculateDynamicBatchSize scales the batch size between cfg.MinBatchSize
+// and cfg.MaxBatchSize based on current CPU, memory, and queue pressure.
+func calculateDynamicBatchSize(metrics sysinfo.Metrics, cfg Config) int {
+	// Reduce batch size if system is under pressure
+	cpuFactor := math.Max(0, 1-(metrics.CPUUsage/cfg.TargetCPUPercent))
+	memFactor := math.Max(0, 1-(metrics.MemoryUsage/cfg.TargetMemPercent))
+	queueFactor := math.Min(1, metrics.QueueLoad/50) // Increase batch size if queue is filling up
+
+	// Combine factors (weighted average)
+	resourceFactor := (cpuFactor*0.4 + memFactor*0.4 + queueFactor*0.2)
+
+	// Calculate new batch size
+	newBatchSize := int(float64(cfg.MaxBatchSize) * resourceFactor)
+
+	// Ensure we stay within bounds
+	if newBatchSize < cfg.MinBatchSize {
+		return cfg.MinBatchSize
+	}
+	if newBatchSize > cfg.MaxBatchSize {
+		return cfg.MaxBatchSize
+	}
+
+	return newBatchSize
+}
+
+// FlushBatch marshals batch and hands it to the sink, acking the delivered
+// messages out of the outbox on success or retrying/dead-lettering them on
+// failure.
+func (m *Manager) FlushBatch(batch []queuedMessage) {
+	msgs := make([]transport.Message, len(batch))
+	seqs := make([]uint64, len(batch))
+	for i, qm := range batch {
+		msgs[i] = qm.Msg
+		seqs[i] = qm.Seq
+	}
+
+	payload, err := json.Marshal(msgs)
+	if err != nil {
+		fmt.Printf("Error marshalling batch: %v\n", err)
+		return
+	}
+
+	fmt.Printf("Flushing batch with %d messages...\n", len(batch))
+	status, body, err := m.sink.Send(payload)
+	if err != nil {
+		fmt.Printf("Error sending batch: %v\n", err)
+		m.retryOrDeadLetter(batch)
+		return
+	}
+
+	if status != 201 {
+		fmt.Printf("Failed to send batch, status: %d, body: %s\n", status, string(body))
+		m.retryOrDeadLetter(batch)
+		return
+	}
+
+	if err := m.ack(seqs); err != nil {
+		fmt.Printf("Error acking batch in outbox: %v\n", err)
+		return
+	}
+
+	m.mu.Lock()
+	m.lastFlush = time.Now()
+	m.mu.Unlock()
+}
+
+// LastFlush reports when a batch was last successfully acked, the zero
+// time if none has succeeded yet.
+func (m *Manager) LastFlush() time.Time {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.lastFlush
+}
+
+func (m *Manager) ack(seqs []uint64) error {
+	return m.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(outboxBucket)
+		for _, seq := range seqs {
+			if err := bucket.Delete(itob(seq)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// retryOrDeadLetter bumps the attempt count for each message in a failed
+// batch; once a message reaches cfg.MaxRetries it is dead-lettered,
+// otherwise it is re-queued after an exponential backoff delay.
+func (m *Manager) retryOrDeadLetter(batch []queuedMessage) {
+	cfg := m.Config()
+	for _, qm := range batch {
+		entry, err := m.bumpAttempts(qm.Seq)
+		if err != nil {
+			fmt.Printf("Error bumping retry count for message %d: %v\n", qm.Seq, err)
+			continue
+		}
+
+		if entry.Attempts >= cfg.MaxRetries {
+			if err := m.deadLetter(qm.Seq, entry); err != nil {
+				fmt.Printf("Error dead-lettering message %d: %v\n", qm.Seq, err)
+			} else {
+				fmt.Printf("Message %d exceeded %d attempts, moved to dead-letter queue\n", qm.Seq, cfg.MaxRetries)
+			}
+			continue
+		}
+
+		// m.retryCh is never closed, so this fire-and-forget timer can
+		// never race Run's close of m.ch on shutdown (see Run's done
+		// case); any retry still pending at shutdown is replayed from
+		// the outbox bucket on the next startup.
+		backoff := cfg.RetryBaseDelay * time.Duration(1<<uint(entry.Attempts-1))
+		qm := qm
+		time.AfterFunc(backoff, func() {
+			m.retryCh <- qm
+		})
+	}
+}
+
+func (m *Manager) bumpAttempts(seq uint64) (outboxEntry, error) {
+	var entry outboxEntry
+	err := m.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(outboxBucket)
+		data := bucket.Get(itob(seq))
+		if data == nil {
+			return fmt.Errorf("outbox entry %d not found", seq)
+		}
+		if err := json.Unmarshal(data, &entry); err != nil {
+			return err
+		}
+		entry.Attempts++
+
+		updated, err := json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+		return bucket.Put(itob(seq), updated)
+	})
+	return entry, err
+}
+
+func (m *Manager) deadLetter(seq uint64, entry outboxEntry) error {
+	return m.db.Update(func(tx *bolt.Tx) error {
+		outbox := tx.Bucket(outboxBucket)
+		dlq := tx.Bucket(dlqBucket)
+
+		data, err := json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+		if err := dlq.Put(itob(seq), data); err != nil {
+			return err
+		}
+		return outbox.Delete(itob(seq))
+	})
+}
@@ -0,0 +1,212 @@
+package queue
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+
+	"tendrl/agent/internal/sysinfo"
+	"tendrl/agent/internal/transport"
+)
+
+func TestCalculateDynamicBatchSize(t *testing.T) {
+	cfg := Config{
+		MinBatchSize:     10,
+		MaxBatchSize:     200,
+		TargetCPUPercent: 70,
+		TargetMemPercent: 80,
+	}
+
+	cases := []struct {
+		name    string
+		metrics sysinfo.Metrics
+		want    int
+	}{
+		{
+			name:    "fully idle system maximizes resource factor",
+			metrics: sysinfo.Metrics{CPUUsage: 0, MemoryUsage: 0, QueueLoad: 0},
+			want:    160, // 200 * (1*0.4 + 1*0.4 + 0*0.2)
+		},
+		{
+			name:    "cpu at target, mem idle, queue empty",
+			metrics: sysinfo.Metrics{CPUUsage: 70, MemoryUsage: 0, QueueLoad: 0},
+			want:    80, // 200 * (0*0.4 + 1*0.4 + 0*0.2)
+		},
+		{
+			name:    "cpu and mem both over target clamps to min",
+			metrics: sysinfo.Metrics{CPUUsage: 140, MemoryUsage: 160, QueueLoad: 0},
+			want:    10,
+		},
+		{
+			name:    "queue backlog alone raises batch size toward max",
+			metrics: sysinfo.Metrics{CPUUsage: 70, MemoryUsage: 80, QueueLoad: 100},
+			want:    40, // 200 * (0*0.4 + 0*0.4 + 1*0.2)
+		},
+		{
+			name:    "no load at all maximizes batch size",
+			metrics: sysinfo.Metrics{CPUUsage: 0, MemoryUsage: 0, QueueLoad: 100},
+			want:    200,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := calculateDynamicBatchSize(tc.metrics, cfg)
+			if got != tc.want {
+				t.Errorf("calculateDynamicBatchSize(%+v) = %d, want %d", tc.metrics, got, tc.want)
+			}
+		})
+	}
+}
+
+func newTestManager(t *testing.T, sink Sink) *Manager {
+	t.Helper()
+	dbPath := filepath.Join(t.TempDir(), "tether.db")
+	db, err := bolt.Open(dbPath, 0660, nil)
+	if err != nil {
+		t.Fatalf("failed to open test db: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	cfg := Config{
+		MinBatchSize:     1,
+		MaxBatchSize:     10,
+		TargetCPUPercent: 70,
+		TargetMemPercent: 80,
+		MaxQueueSize:     10,
+		MinBatchInterval: 10 * time.Millisecond,
+		MaxBatchInterval: 20 * time.Millisecond,
+		MaxRetries:       3,
+		RetryBaseDelay:   5 * time.Millisecond,
+	}
+	noLoad := func(queueLen, maxQueueSize int) sysinfo.Metrics { return sysinfo.Metrics{} }
+
+	mgr := NewManager(db, cfg, noLoad, sink)
+	if err := mgr.Init(); err != nil {
+		t.Fatalf("failed to init buckets: %v", err)
+	}
+	return mgr
+}
+
+// TestFlushBatchRetriesThenAcks exercises FlushBatch against a fake HTTP
+// server that fails the first two attempts before succeeding, verifying
+// the message is retried with backoff and then acked out of the outbox.
+func TestFlushBatchRetriesThenAcks(t *testing.T) {
+	var attempts int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		if attempts < 3 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer server.Close()
+
+	sink := NewHTTPSink(server.Client(), server.URL, "test-key", "", 0)
+	mgr := newTestManager(t, sink)
+
+	seq, err := mgr.persist(transport.Message{Data: "hello"})
+	if err != nil {
+		t.Fatalf("persist failed: %v", err)
+	}
+	qm := queuedMessage{Seq: seq, Msg: transport.Message{Data: "hello"}}
+
+	mgr.FlushBatch([]queuedMessage{qm})
+	if pending, _, _ := mgr.Stats(); pending != 1 {
+		t.Fatalf("expected message still pending after first failure, got pending=%d", pending)
+	}
+
+	// Retry was scheduled via time.AfterFunc; drain it back through FlushBatch.
+	retried := <-mgr.retryCh
+	mgr.FlushBatch([]queuedMessage{retried})
+	if pending, _, _ := mgr.Stats(); pending != 1 {
+		t.Fatalf("expected message still pending after second failure, got pending=%d", pending)
+	}
+
+	retried = <-mgr.retryCh
+	mgr.FlushBatch([]queuedMessage{retried})
+	if pending, dlq, _ := mgr.Stats(); pending != 0 || dlq != 0 {
+		t.Fatalf("expected message acked after success, got pending=%d dlq=%d", pending, dlq)
+	}
+
+	if attempts != 3 {
+		t.Fatalf("expected 3 HTTP attempts, got %d", attempts)
+	}
+}
+
+// TestFlushBatchDeadLettersAfterMaxRetries verifies a message that never
+// succeeds is moved to the dead-letter bucket once it exceeds MaxRetries.
+func TestFlushBatchDeadLettersAfterMaxRetries(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	sink := NewHTTPSink(server.Client(), server.URL, "test-key", "", 0)
+	mgr := newTestManager(t, sink)
+
+	seq, err := mgr.persist(transport.Message{Data: "never-delivered"})
+	if err != nil {
+		t.Fatalf("persist failed: %v", err)
+	}
+	qm := queuedMessage{Seq: seq, Msg: transport.Message{Data: "never-delivered"}}
+
+	for i := 0; i < mgr.Config().MaxRetries; i++ {
+		mgr.FlushBatch([]queuedMessage{qm})
+		if i < mgr.Config().MaxRetries-1 {
+			qm = <-mgr.retryCh
+		}
+	}
+
+	pending, dlq, err := mgr.Stats()
+	if err != nil {
+		t.Fatalf("stats failed: %v", err)
+	}
+	if pending != 0 || dlq != 1 {
+		t.Fatalf("expected message dead-lettered, got pending=%d dlq=%d", pending, dlq)
+	}
+}
+
+// TestStopDoesNotPanicOnPendingRetry guards against a failed flush's
+// backoff timer firing after Stop has closed m.ch: the retry must be
+// delivered through the Run-owned retryCh, not the channel Stop closes.
+func TestStopDoesNotPanicOnPendingRetry(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	sink := NewHTTPSink(server.Client(), server.URL, "test-key", "", 0)
+	mgr := newTestManager(t, sink)
+
+	seq, err := mgr.persist(transport.Message{Data: "racing-retry"})
+	if err != nil {
+		t.Fatalf("persist failed: %v", err)
+	}
+	qm := queuedMessage{Seq: seq, Msg: transport.Message{Data: "racing-retry"}}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		mgr.Run()
+	}()
+
+	// Schedules a backoff timer that fires after Stop closes m.ch.
+	mgr.FlushBatch([]queuedMessage{qm})
+	mgr.Stop()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Run did not return after Stop")
+	}
+
+	// The retry timer still fires after Run has returned; it must not
+	// panic sending into a closed channel.
+	time.Sleep(2 * mgr.Config().RetryBaseDelay)
+}
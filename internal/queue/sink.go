@@ -0,0 +1,104 @@
+package queue
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net/http"
+	"sync/atomic"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// HTTPSink is the production Sink, POSTing batches to the app over HTTP.
+// Its API key is stored atomically so it can be rotated via SetApiKey while
+// Send is concurrently in flight.
+type HTTPSink struct {
+	Client      *http.Client
+	URL         string
+	Compression CompressionMode // CompressionNone if zero-valued
+
+	// GzipLevel is the level used when Compression is CompressionGzip.
+	// Callers must resolve "unset" to DefaultGzipLevel themselves: 0 is
+	// the valid gzip.NoCompression level, not a sentinel for "not set".
+	GzipLevel int
+
+	apiKey atomic.Value // string
+}
+
+// NewHTTPSink builds an HTTPSink ready to deliver batches.
+func NewHTTPSink(client *http.Client, url string, apiKey string, compression CompressionMode, gzipLevel int) *HTTPSink {
+	h := &HTTPSink{Client: client, URL: url, Compression: compression, GzipLevel: gzipLevel}
+	h.apiKey.Store(apiKey)
+	return h
+}
+
+// SetApiKey rotates the key used to authenticate subsequent Send calls.
+func (h *HTTPSink) SetApiKey(key string) {
+	h.apiKey.Store(key)
+}
+
+// ApiKey reports the key currently used to authenticate Send calls.
+func (h *HTTPSink) ApiKey() string {
+	key, _ := h.apiKey.Load().(string)
+	return key
+}
+
+func (h *HTTPSink) Send(payload []byte) (int, []byte, error) {
+	body, encoding, err := compress(payload, h.Compression, h.GzipLevel)
+	if err != nil {
+		fmt.Println(err)
+	}
+
+	req, err := http.NewRequest("POST", h.URL, bytes.NewBuffer(body))
+	if err != nil {
+		return 0, nil, fmt.Errorf("error creating request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+h.ApiKey())
+	req.Header.Set("Content-Type", "application/json")
+	// Setting Accept-Encoding explicitly opts out of net/http's built-in
+	// transparent gzip decoding (see the Transport docs), so the response
+	// must be decompressed here based on Content-Encoding.
+	req.Header.Set("Accept-Encoding", "gzip, zstd")
+	if encoding != "" {
+		req.Header.Set("Content-Encoding", encoding)
+	}
+
+	resp, err := h.Client.Do(req)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := decodeResponseBody(resp)
+	if err != nil {
+		return resp.StatusCode, nil, fmt.Errorf("decoding %s response: %w", resp.Header.Get("Content-Encoding"), err)
+	}
+	return resp.StatusCode, respBody, nil
+}
+
+// decodeResponseBody reads resp.Body, transparently undoing whatever
+// Content-Encoding the app responded with.
+func decodeResponseBody(resp *http.Response) ([]byte, error) {
+	switch resp.Header.Get("Content-Encoding") {
+	case "gzip":
+		r, err := gzip.NewReader(resp.Body)
+		if err != nil {
+			return nil, err
+		}
+		defer r.Close()
+		return io.ReadAll(r)
+
+	case "zstd":
+		r, err := zstd.NewReader(resp.Body)
+		if err != nil {
+			return nil, err
+		}
+		defer r.Close()
+		return io.ReadAll(r)
+
+	default:
+		return io.ReadAll(resp.Body)
+	}
+}
@@ -0,0 +1,76 @@
+package queue
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestHTTPSinkDecodesGzipResponse verifies Send decompresses a gzipped
+// response body instead of handing the raw bytes back to the caller, since
+// setting Accept-Encoding manually disables net/http's built-in decoding.
+func TestHTTPSinkDecodesGzipResponse(t *testing.T) {
+	const want = `{"status":"accepted"}`
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var buf bytes.Buffer
+		gw := gzip.NewWriter(&buf)
+		gw.Write([]byte(want))
+		gw.Close()
+
+		w.Header().Set("Content-Encoding", "gzip")
+		w.WriteHeader(http.StatusCreated)
+		w.Write(buf.Bytes())
+	}))
+	defer server.Close()
+
+	sink := NewHTTPSink(server.Client(), server.URL, "test-key", CompressionNone, 0)
+	status, body, err := sink.Send([]byte("payload"))
+	if err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+	if status != http.StatusCreated {
+		t.Fatalf("expected status 201, got %d", status)
+	}
+	if string(body) != want {
+		t.Fatalf("expected decoded body %q, got %q", want, body)
+	}
+}
+
+// TestHTTPSinkHonorsExplicitZeroGzipLevel verifies GzipLevel: 0 is treated
+// as gzip.NoCompression rather than being silently promoted to
+// DefaultGzipLevel.
+func TestHTTPSinkHonorsExplicitZeroGzipLevel(t *testing.T) {
+	payload := bytes.Repeat([]byte("repeated filler text "), 200)
+
+	var noCompressionLen, defaultLevelLen int
+	for _, tc := range []struct {
+		level int
+		store *int
+	}{
+		{level: gzip.NoCompression, store: &noCompressionLen},
+		{level: DefaultGzipLevel, store: &defaultLevelLen},
+	} {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, err := io.ReadAll(r.Body)
+			if err != nil {
+				t.Fatalf("reading request body: %v", err)
+			}
+			*tc.store = len(body)
+			w.WriteHeader(http.StatusCreated)
+		}))
+
+		sink := NewHTTPSink(server.Client(), server.URL, "test-key", CompressionGzip, tc.level)
+		if _, _, err := sink.Send(payload); err != nil {
+			t.Fatalf("Send failed at level %d: %v", tc.level, err)
+		}
+		server.Close()
+	}
+
+	if noCompressionLen <= defaultLevelLen {
+		t.Fatalf("expected GzipLevel=0 (NoCompression, %d bytes) to be larger than DefaultGzipLevel (%d bytes); an explicit 0 was not honored", noCompressionLen, defaultLevelLen)
+	}
+}
@@ -0,0 +1,60 @@
+// Package sysinfo reports host resource usage used to drive the agent's
+// adaptive batching decisions.
+package sysinfo
+
+import (
+	"time"
+
+	"github.com/shirou/gopsutil/cpu"
+	"github.com/shirou/gopsutil/mem"
+)
+
+// Metrics is a snapshot of host load at the moment it was sampled.
+type Metrics struct {
+	CPUUsage    float64
+	MemoryUsage float64
+	QueueLoad   float64 // Current queue size / max queue size, as a percentage
+}
+
+// GetSystemMetrics samples CPU and memory usage and combines it with the
+// caller-supplied queue depth to produce a Metrics snapshot.
+func GetSystemMetrics(queueLen, maxQueueSize int) Metrics {
+	var metrics Metrics
+
+	cpuPercent, err := cpu.Percent(100*time.Millisecond, false)
+	if err == nil && len(cpuPercent) > 0 {
+		metrics.CPUUsage = cpuPercent[0]
+	}
+
+	vm, err := mem.VirtualMemory()
+	if err == nil {
+		metrics.MemoryUsage = vm.UsedPercent
+	}
+
+	if maxQueueSize > 0 {
+		metrics.QueueLoad = float64(queueLen) / float64(maxQueueSize) * 100
+	}
+
+	return metrics
+}
+
+// Convert renders a byte count as the largest whole unit it fits in.
+func Convert(num uint64) (float64, string) {
+	units := []struct {
+		Factor uint64
+		Suffix string
+	}{
+		{1 << 30, "GB"},
+		{1 << 20, "MB"},
+		{1 << 10, "KB"},
+		{1, "bytes"},
+	}
+
+	for _, unit := range units {
+		if num >= unit.Factor {
+			return float64(num) / float64(unit.Factor), unit.Suffix
+		}
+	}
+
+	return float64(num), "bytes"
+}
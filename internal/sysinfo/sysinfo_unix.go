@@ -0,0 +1,29 @@
+//go:build !windows
+
+package sysinfo
+
+import (
+	"fmt"
+	"syscall"
+)
+
+// Free calculates free memory and disk usage.
+func Free() map[string]interface{} {
+	var stat syscall.Statfs_t
+	err := syscall.Statfs("/", &stat)
+	if err != nil {
+		return map[string]interface{}{
+			"error": "failed to get disk stats",
+		}
+	}
+
+	fsSize := stat.Blocks * uint64(stat.Bsize)
+	fsFree := stat.Bfree * uint64(stat.Bsize)
+	fsFreeHuman, fsFreeUnit := Convert(fsFree)
+	fsSizeHuman, fsSizeUnit := Convert(fsSize)
+
+	return map[string]interface{}{
+		"disk_free": fmt.Sprintf("%.2f %s", fsFreeHuman, fsFreeUnit),
+		"disk_size": fmt.Sprintf("%.2f %s", fsSizeHuman, fsSizeUnit),
+	}
+}
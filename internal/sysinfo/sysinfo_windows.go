@@ -0,0 +1,47 @@
+//go:build windows
+
+package sysinfo
+
+import (
+	"fmt"
+	"syscall"
+	"unsafe"
+)
+
+// MEMORYSTATUSEX represents the memory status structure used by GlobalMemoryStatusEx
+type MEMORYSTATUSEX struct {
+	Length               uint32
+	MemoryLoad           uint32
+	TotalPhys            uint64
+	AvailPhys            uint64
+	TotalPageFile        uint64
+	AvailPageFile        uint64
+	TotalVirtual         uint64
+	AvailVirtual         uint64
+	AvailExtendedVirtual uint64
+}
+
+// Free calculates free memory and disk usage on Windows
+func Free() map[string]interface{} {
+	kernel32 := syscall.NewLazyDLL("kernel32.dll")
+	globalMemoryStatusEx := kernel32.NewProc("GlobalMemoryStatusEx")
+
+	memStatus := MEMORYSTATUSEX{
+		Length: uint32(unsafe.Sizeof(MEMORYSTATUSEX{})),
+	}
+
+	ret, _, err := globalMemoryStatusEx.Call(uintptr(unsafe.Pointer(&memStatus)))
+	if ret == 0 {
+		return map[string]interface{}{
+			"error": fmt.Sprintf("failed to get memory stats: %v", err),
+		}
+	}
+
+	availPhysHuman, availUnit := Convert(memStatus.AvailPhys)
+	totalPhysHuman, totalUnit := Convert(memStatus.TotalPhys)
+
+	return map[string]interface{}{
+		"mem_free":  fmt.Sprintf("%.2f %s", availPhysHuman, availUnit),
+		"mem_total": fmt.Sprintf("%.2f %s", totalPhysHuman, totalUnit),
+	}
+}
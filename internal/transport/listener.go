@@ -0,0 +1,80 @@
+package transport
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"os"
+)
+
+// Transport names accepted by the --transport flag.
+const (
+	TransportUnix    = "unix"
+	TransportNPipe   = "npipe"
+	TransportTCPMTLS = "tcp+mtls"
+)
+
+// ListenerConfig selects and configures one of the supported listener
+// transports. Only the fields relevant to the selected Transport are used.
+type ListenerConfig struct {
+	Transport   string
+	SocketPath  string // unix
+	PipeName    string // npipe
+	ListenAddr  string // tcp+mtls
+	TLSCert     string // tcp+mtls
+	TLSKey      string // tcp+mtls
+	TLSClientCA string // tcp+mtls
+}
+
+// Listen opens a net.Listener for cfg.Transport. HandleConnection works
+// unchanged against the result since it only depends on net.Conn.
+func Listen(cfg ListenerConfig) (net.Listener, error) {
+	switch cfg.Transport {
+	case TransportUnix:
+		return listenUnix(cfg.SocketPath)
+	case TransportNPipe:
+		return listenNamedPipe(cfg.PipeName)
+	case TransportTCPMTLS:
+		return listenTCPMTLS(cfg)
+	default:
+		return nil, fmt.Errorf("unknown transport %q", cfg.Transport)
+	}
+}
+
+func listenUnix(socketPath string) (net.Listener, error) {
+	os.Remove(socketPath)
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		return nil, fmt.Errorf("AF_UNIX listener error: %w", err)
+	}
+	return listener, nil
+}
+
+func listenTCPMTLS(cfg ListenerConfig) (net.Listener, error) {
+	cert, err := tls.LoadX509KeyPair(cfg.TLSCert, cfg.TLSKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load server certificate: %w", err)
+	}
+
+	caPEM, err := os.ReadFile(cfg.TLSClientCA)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read client CA: %w", err)
+	}
+	clientCAs := x509.NewCertPool()
+	if !clientCAs.AppendCertsFromPEM(caPEM) {
+		return nil, fmt.Errorf("failed to parse client CA %q", cfg.TLSClientCA)
+	}
+
+	tlsConfig := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		ClientCAs:    clientCAs,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+	}
+
+	listener, err := tls.Listen("tcp", cfg.ListenAddr, tlsConfig)
+	if err != nil {
+		return nil, fmt.Errorf("tcp+mtls listener error: %w", err)
+	}
+	return listener, nil
+}
@@ -0,0 +1,13 @@
+//go:build !windows
+
+package transport
+
+import (
+	"fmt"
+	"net"
+)
+
+// listenNamedPipe is unavailable outside Windows.
+func listenNamedPipe(pipeName string) (net.Listener, error) {
+	return nil, fmt.Errorf("named pipe transport is only supported on Windows")
+}
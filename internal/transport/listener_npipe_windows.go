@@ -0,0 +1,24 @@
+//go:build windows
+
+package transport
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/Microsoft/go-winio"
+)
+
+// listenNamedPipe opens a Windows named pipe listener at \\.\pipe\<pipeName>.
+func listenNamedPipe(pipeName string) (net.Listener, error) {
+	path := pipeName
+	if len(path) < 9 || path[:9] != `\\.\pipe\` {
+		path = `\\.\pipe\` + pipeName
+	}
+
+	listener, err := winio.ListenPipe(path, nil)
+	if err != nil {
+		return nil, fmt.Errorf("named pipe listener error: %w", err)
+	}
+	return listener, nil
+}
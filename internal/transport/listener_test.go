@@ -0,0 +1,242 @@
+package transport
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+)
+
+// fakeQueue is a no-op Queue used by tests that only exercise the
+// wait=true path, which never touches the queue.
+type fakeQueue struct{}
+
+func (fakeQueue) Enqueue(msg Message) (uint64, error)      { return 0, nil }
+func (fakeQueue) Stats() (pending int, dlq int, err error) { return 0, 0, nil }
+func (fakeQueue) EffectiveConfig() map[string]interface{}  { return map[string]interface{}{} }
+
+// roundTripPublish dials listener, sends a publish message with wait=true,
+// and returns the decoded response.
+func roundTripPublish(t *testing.T, dial func() (net.Conn, error)) map[string]interface{} {
+	t.Helper()
+
+	conn, err := dial()
+	if err != nil {
+		t.Fatalf("dial failed: %v", err)
+	}
+	defer conn.Close()
+
+	msg := Message{
+		Data:    "hello",
+		MsgType: "publish",
+		Context: MessageContext{WaitResponse: true},
+	}
+	if err := json.NewEncoder(conn).Encode(msg); err != nil {
+		t.Fatalf("failed to write message: %v", err)
+	}
+
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var resp map[string]interface{}
+	if err := json.NewDecoder(conn).Decode(&resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	return resp
+}
+
+func newTestServer(appServer *httptest.Server) *Server {
+	return NewServer(fakeQueue{}, appServer.Client(), Config{AppURL: appServer.URL, ApiKey: "test-key"})
+}
+
+func newFakeApp(t *testing.T) *httptest.Server {
+	t.Helper()
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"status": "accepted"})
+	}))
+}
+
+func TestUnixTransportRoundTrip(t *testing.T) {
+	appServer := newFakeApp(t)
+	defer appServer.Close()
+
+	socketPath := filepath.Join(t.TempDir(), "agent.sock")
+	listener, err := Listen(ListenerConfig{Transport: TransportUnix, SocketPath: socketPath})
+	if err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	defer listener.Close()
+
+	srv := newTestServer(appServer)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		srv.HandleConnection(conn)
+	}()
+
+	resp := roundTripPublish(t, func() (net.Conn, error) {
+		return net.Dial("unix", socketPath)
+	})
+	if resp["status"] != "accepted" {
+		t.Fatalf("unexpected response: %v", resp)
+	}
+}
+
+func TestTCPMTLSTransportRoundTrip(t *testing.T) {
+	appServer := newFakeApp(t)
+	defer appServer.Close()
+
+	dir := t.TempDir()
+	serverCertPath, serverKeyPath, caCertPath, clientCert := generateMTLSFixtures(t, dir)
+
+	listener, err := Listen(ListenerConfig{
+		Transport:   TransportTCPMTLS,
+		ListenAddr:  "127.0.0.1:0",
+		TLSCert:     serverCertPath,
+		TLSKey:      serverKeyPath,
+		TLSClientCA: caCertPath,
+	})
+	if err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	defer listener.Close()
+
+	srv := newTestServer(appServer)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		srv.HandleConnection(conn)
+	}()
+
+	caPool := x509.NewCertPool()
+	caPool.AddCert(clientCert.ca)
+
+	resp := roundTripPublish(t, func() (net.Conn, error) {
+		return tls.Dial("tcp", listener.Addr().String(), &tls.Config{
+			Certificates: []tls.Certificate{clientCert.cert},
+			RootCAs:      caPool,
+			ServerName:   "localhost",
+		})
+	})
+	if resp["status"] != "accepted" {
+		t.Fatalf("unexpected response: %v", resp)
+	}
+}
+
+func TestNPipeTransportUnsupportedOffWindows(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("named pipe transport is exercised on Windows, not this OS")
+	}
+
+	_, err := Listen(ListenerConfig{Transport: TransportNPipe, PipeName: "tendrl_agent_test"})
+	if err == nil {
+		t.Fatal("expected an error requesting the npipe transport off Windows")
+	}
+}
+
+type mtlsFixture struct {
+	ca   *x509.Certificate
+	cert tls.Certificate
+}
+
+// generateMTLSFixtures writes a self-signed CA, a server cert/key signed by
+// it, and returns a client cert/key signed by the same CA, all under dir.
+func generateMTLSFixtures(t *testing.T, dir string) (serverCertPath, serverKeyPath, caCertPath string, client mtlsFixture) {
+	t.Helper()
+
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate CA key: %v", err)
+	}
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test-ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatalf("failed to create CA cert: %v", err)
+	}
+	caCert, err := x509.ParseCertificate(caDER)
+	if err != nil {
+		t.Fatalf("failed to parse CA cert: %v", err)
+	}
+
+	serverCert, serverKeyBytes := issueLeaf(t, caCert, caKey, "localhost")
+	clientCertDER, clientKeyBytes := issueLeaf(t, caCert, caKey, "tendrl-client")
+
+	caCertPath = writePEM(t, dir, "ca.pem", "CERTIFICATE", caDER)
+	serverCertPath = writePEM(t, dir, "server.pem", "CERTIFICATE", serverCert)
+	serverKeyPath = writePEM(t, dir, "server-key.pem", "EC PRIVATE KEY", serverKeyBytes)
+	writePEM(t, dir, "client.pem", "CERTIFICATE", clientCertDER)
+	clientKeyPath := writePEM(t, dir, "client-key.pem", "EC PRIVATE KEY", clientKeyBytes)
+
+	clientTLSCert, err := tls.LoadX509KeyPair(filepath.Join(dir, "client.pem"), clientKeyPath)
+	if err != nil {
+		t.Fatalf("failed to load client cert: %v", err)
+	}
+
+	return serverCertPath, serverKeyPath, caCertPath, mtlsFixture{ca: caCert, cert: clientTLSCert}
+}
+
+func issueLeaf(t *testing.T, ca *x509.Certificate, caKey *ecdsa.PrivateKey, commonName string) (certDER, keyDER []byte) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate leaf key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		DNSNames:     []string{commonName},
+	}
+	certDER, err = x509.CreateCertificate(rand.Reader, template, ca, &key.PublicKey, caKey)
+	if err != nil {
+		t.Fatalf("failed to create leaf cert: %v", err)
+	}
+	keyDER, err = x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("failed to marshal leaf key: %v", err)
+	}
+	return certDER, keyDER
+}
+
+func writePEM(t *testing.T, dir, name, blockType string, der []byte) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("failed to create %s: %v", name, err)
+	}
+	defer f.Close()
+
+	if err := pem.Encode(f, &pem.Block{Type: blockType, Bytes: der}); err != nil {
+		t.Fatalf("failed to write %s: %v", name, err)
+	}
+	return path
+}
@@ -0,0 +1,248 @@
+// Package transport owns the agent's socket-facing protocol: framing
+// incoming connections as JSON messages, validating them, and routing them
+// either straight through to the app or into the durable queue.
+package transport
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"sync/atomic"
+)
+
+// MessageContext carries the optional per-message metadata a client can
+// attach to a publish or check request.
+type MessageContext struct {
+	Tags         []string    `json:"tags,omitempty"`
+	Limit        interface{} `json:"-"`
+	WaitResponse bool        `json:"wait,omitempty"`
+	Entity       string      `json:"entity,omitempty"`
+}
+
+// Message is the wire format exchanged over the agent socket.
+type Message struct {
+	Data        string         `json:"data,omitempty"` //omitempty to allow check_msg with no data
+	Context     MessageContext `json:"context,omitempty"`
+	MsgType     string         `json:"msg_type,omitempty"`
+	Destination string         `json:"dest,omitempty"`
+	Timestamp   string         `json:"timestamp,omitempty"`
+}
+
+// ResponseMessage is returned to the client for error and status replies.
+type ResponseMessage struct {
+	Status  string `json:"status"`
+	Message string `json:"message,omitempty"`
+}
+
+// Queue is the subset of the queue manager that transport needs: durably
+// accepting a message for later delivery, reporting its depth, and
+// reporting its effective tuning for the "config_get" admin command.
+type Queue interface {
+	Enqueue(msg Message) (uint64, error)
+	Stats() (pending int, dlq int, err error)
+	EffectiveConfig() map[string]interface{}
+}
+
+// Config holds the app-facing settings transport needs for the
+// request/response paths that bypass the queue (msg_check, wait=true).
+type Config struct {
+	AppURL string
+	ApiKey string
+}
+
+// Server handles connections on the agent socket, routing messages to the
+// app directly or through the durable Queue.
+type Server struct {
+	Queue  Queue
+	Client *http.Client
+
+	cfg atomic.Pointer[Config]
+}
+
+// NewServer builds a Server ready to handle connections.
+func NewServer(q Queue, client *http.Client, cfg Config) *Server {
+	s := &Server{Queue: q, Client: client}
+	s.cfg.Store(&cfg)
+	return s
+}
+
+// Config returns the Server's current effective configuration.
+func (s *Server) Config() Config {
+	return *s.cfg.Load()
+}
+
+// UpdateConfig atomically swaps the Server's app-facing configuration,
+// e.g. to rotate the API key used for msg_check and wait=true requests.
+func (s *Server) UpdateConfig(cfg Config) {
+	s.cfg.Store(&cfg)
+}
+
+func ValidateClientContext(ctx *MessageContext) error {
+	if ctx != nil && len(ctx.Tags) > 10 {
+		return fmt.Errorf("too many tags provided; maximum is 10")
+	}
+	return nil
+}
+
+func (s *Server) HandleConnection(conn net.Conn) {
+	defer conn.Close()
+	decoder := json.NewDecoder(bufio.NewReader(conn))
+
+	for {
+		var msg Message
+		if err := decoder.Decode(&msg); err == io.EOF {
+			fmt.Println("Connection closed by client")
+			break
+		} else if err != nil {
+			fmt.Printf("Error decoding JSON message: %v\n", err)
+			continue
+		}
+
+		err := ValidateClientContext(&msg.Context)
+		if err != nil {
+			log.Print(err)
+			sendErrorResponse(conn, err.Error())
+			continue
+		}
+
+		s.ProcessMessage(conn, msg)
+	}
+}
+
+func (s *Server) ProcessMessage(conn net.Conn, msg Message) {
+	if len(msg.Context.Tags) > 0 {
+		fmt.Printf("Processing message with tags: %v\n", msg.Context.Tags)
+	}
+
+	switch msg.MsgType {
+	case "msg_check":
+		limit := 1
+		var ok bool
+		if msg.Context.Limit != nil {
+			limit, ok = msg.Context.Limit.(int)
+			if !ok {
+				sendErrorResponse(conn, "Invalid limit type")
+				return
+			}
+		}
+
+		messages, err := s.checkMessage(limit)
+		if err != nil {
+			sendErrorResponse(conn, err.Error())
+			return
+		}
+
+		if len(messages) == 0 {
+			conn.Write([]byte("204"))
+			return
+		}
+		response, _ := json.Marshal(messages)
+		conn.Write(response)
+
+	case "publish":
+		if msg.Context.WaitResponse {
+			resp := s.sendSingleMessage(msg)
+			response, _ := json.Marshal(resp)
+			conn.Write(response)
+			return
+		}
+
+		if _, err := s.Queue.Enqueue(msg); err != nil {
+			sendErrorResponse(conn, fmt.Sprintf("failed to persist message: %v", err))
+			return
+		}
+
+	case "queue_stats":
+		pending, dlq, err := s.Queue.Stats()
+		if err != nil {
+			sendErrorResponse(conn, err.Error())
+			return
+		}
+		response, _ := json.Marshal(map[string]int{"pending": pending, "dlq": dlq})
+		conn.Write(response)
+
+	case "config_get":
+		response, _ := json.Marshal(s.Queue.EffectiveConfig())
+		conn.Write(response)
+
+	default:
+		sendErrorResponse(conn, "Unknown message type")
+	}
+}
+
+func sendErrorResponse(conn net.Conn, errorMsg string) {
+	resp := ResponseMessage{
+		Status:  "error",
+		Message: errorMsg,
+	}
+	data, _ := json.Marshal(resp)
+	conn.Write(data)
+}
+
+func (s *Server) checkMessage(limit int) ([]Message, error) {
+	cfg := s.Config()
+	url := fmt.Sprintf("%s/entities/check_messages?limit=%d", cfg.AppURL, limit)
+
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", cfg.ApiKey))
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	// Match Python's status code handling
+	if resp.StatusCode == 204 {
+		return nil, nil
+	}
+
+	if resp.StatusCode != 200 {
+		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+
+	var response struct {
+		Messages []Message `json:"messages"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return nil, err
+	}
+
+	return response.Messages, nil
+}
+
+func (s *Server) sendSingleMessage(msg Message) interface{} {
+	payload, err := json.Marshal(msg)
+	if err != nil {
+		return map[string]string{"error": err.Error()}
+	}
+
+	cfg := s.Config()
+	req, err := http.NewRequest("POST", cfg.AppURL+"/entities/message", bytes.NewBuffer(payload))
+	if err != nil {
+		return map[string]string{"error": err.Error()}
+	}
+
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", cfg.ApiKey))
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return map[string]string{"error": err.Error()}
+	}
+	defer resp.Body.Close()
+
+	var result interface{}
+	json.NewDecoder(resp.Body).Decode(&result)
+	return result
+}